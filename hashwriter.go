@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// supportedHashAlgos按-hash可接受的取值列出当前支持的算法。
+var supportedHashAlgos = []string{"md5", "crc32", "sha1", "sha256", "sha512", "blake3"}
+
+// newHasher根据算法名创建对应的hash.Hash实现。
+func newHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case "md5":
+		return md5.New(), nil
+	case "crc32":
+		return crc32.NewIEEE(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "blake3":
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的哈希算法 %q，可选: %v", algo, supportedHashAlgos)
+	}
+}
+
+// hashUnit是AsyncHashWriter内部对应单个算法的计算单元，运行在自己的
+// goroutine中，与最初只支持SHA256时的单算法设计保持一致的模型。
+type hashUnit struct {
+	algo     string
+	hasher   hash.Hash
+	dataCh   chan []byte
+	doneCh   chan struct{}
+	resultCh chan string
+}
+
+// AsyncHashWriter把单个输入字节流并行扇出给多个哈希算法的goroutine，
+// 是早期单算法SHA256异步写入器的通用化版本：Write同步写入目标writer后，
+// 再异步把数据副本分发给每个算法的计算协程。
+type AsyncHashWriter struct {
+	writer io.Writer
+	units  []*hashUnit
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewAsyncHashWriter创建一个AsyncHashWriter，为algos中列出的每个算法
+// 各启动一个计算协程。
+func NewAsyncHashWriter(writer io.Writer, algos []string) (*AsyncHashWriter, error) {
+	return NewAsyncHashWriterResumed(writer, algos, nil, 0)
+}
+
+// NewAsyncHashWriterResumed与NewAsyncHashWriter类似，但会先从seed同步读取
+// seedLen字节喂给每个哈希器，用于-resume续传时回放已写入部分的滚动状态，
+// 之后才启动异步协程处理后续写入。seed为nil或seedLen<=0时与
+// NewAsyncHashWriter行为一致。
+func NewAsyncHashWriterResumed(writer io.Writer, algos []string, seed io.Reader, seedLen int64) (*AsyncHashWriter, error) {
+	ahw := &AsyncHashWriter{writer: writer}
+	for _, algo := range algos {
+		h, err := newHasher(algo)
+		if err != nil {
+			return nil, err
+		}
+		ahw.units = append(ahw.units, &hashUnit{
+			algo:     algo,
+			hasher:   h,
+			dataCh:   make(chan []byte, 10), // 缓冲通道提高性能
+			doneCh:   make(chan struct{}),
+			resultCh: make(chan string, 1),
+		})
+	}
+
+	if seed != nil && seedLen > 0 {
+		buf := make([]byte, 1<<20)
+		remaining := seedLen
+		for remaining > 0 {
+			toRead := int64(len(buf))
+			if remaining < toRead {
+				toRead = remaining
+			}
+			n, rerr := seed.Read(buf[:toRead])
+			if n > 0 {
+				for _, u := range ahw.units {
+					u.hasher.Write(buf[:n])
+				}
+				remaining -= int64(n)
+			}
+			if rerr != nil {
+				if rerr != io.EOF {
+					log.Printf("警告: 回放哈希状态时出错，最终校验和可能不准确: %v", rerr)
+				}
+				break
+			}
+		}
+	}
+
+	for _, u := range ahw.units {
+		go ahw.hashWorker(u)
+	}
+
+	return ahw, nil
+}
+
+func (ahw *AsyncHashWriter) hashWorker(u *hashUnit) {
+	for {
+		select {
+		case data := <-u.dataCh:
+			if data == nil {
+				// 收到结束信号
+				u.resultCh <- hex.EncodeToString(u.hasher.Sum(nil))
+				return
+			}
+			u.hasher.Write(data)
+		case <-u.doneCh:
+			// 强制结束
+			return
+		}
+	}
+}
+
+func (ahw *AsyncHashWriter) Write(p []byte) (n int, err error) {
+	// 先写入到目标writer
+	n, err = ahw.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	// 异步发送数据给各个哈希计算器
+	ahw.mu.Lock()
+	if !ahw.closed && n > 0 {
+		// 创建数据副本以避免竞态条件
+		dataCopy := make([]byte, n)
+		copy(dataCopy, p[:n])
+		for _, u := range ahw.units {
+			u.dataCh <- dataCopy
+		}
+	}
+	ahw.mu.Unlock()
+
+	return n, nil
+}
+
+func (ahw *AsyncHashWriter) Close() {
+	ahw.mu.Lock()
+	if !ahw.closed {
+		ahw.closed = true
+		for _, u := range ahw.units {
+			u.dataCh <- nil
+		}
+	}
+	ahw.mu.Unlock()
+}
+
+// Sums等待全部算法计算完成，返回{算法名: 十六进制摘要}。
+func (ahw *AsyncHashWriter) Sums() map[string]string {
+	ahw.Close()
+
+	type result struct {
+		algo string
+		sum  string
+	}
+	resCh := make(chan result, len(ahw.units))
+	for _, u := range ahw.units {
+		u := u
+		go func() {
+			select {
+			case sum := <-u.resultCh:
+				resCh <- result{u.algo, sum}
+			case <-time.After(30 * time.Second): // 超时保护
+				close(u.doneCh)
+				resCh <- result{u.algo, ""}
+			}
+		}()
+	}
+
+	sums := make(map[string]string, len(ahw.units))
+	for range ahw.units {
+		r := <-resCh
+		sums[r.algo] = r.sum
+	}
+	return sums
+}
+
+// recomputeWholeFileHashes对path做一次完整的重新流式哈希。
+//
+// -resume续传完成后replayResumeEntries会把续传前条目的中央目录记录插回
+// 归档中间，这之后destFile的字节内容已经不再是AsyncHashWriter增量计算
+// 时见过的那个字节流——滚动哈希无法在文件中间插入字节后还继续保持
+// 有效，因此整份归档的校验和必须重新算一遍，而不是信任hashWriter.Sums()。
+func recomputeWholeFileHashes(path string, algos []string) (map[string]string, error) {
+	hashers := make(map[string]hash.Hash, len(algos))
+	for _, algo := range algos {
+		h, err := newHasher(algo)
+		if err != nil {
+			continue
+		}
+		hashers[algo] = h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 %s 以重新计算校验和: %w", path, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 5*1024*1024)
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			for _, h := range hashers {
+				h.Write(buf[:n])
+			}
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				return nil, fmt.Errorf("重新计算 %s 的校验和时出错: %w", path, readErr)
+			}
+			break
+		}
+	}
+
+	sums := make(map[string]string, len(hashers))
+	for algo, h := range hashers {
+		sums[algo] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Archiver 抽象了一种归档容器格式，用于在不同的输出后端之间
+// 共享同一套扫描/排序/进度上报流程。目前由TarArchiver实现。
+type Archiver interface {
+	// AddFile 写入一个文件条目，返回其内容在底层流中的起始偏移量。
+	AddFile(zipPath string, info os.FileInfo, r io.Reader) (offset int64, err error)
+	Close() error
+}
+
+// TarArchiver 是Archiver在tar容器格式下的实现，按调用顺序
+// 把文件追加到底层写入器，同时记录已写入的字节偏移量。
+type TarArchiver struct {
+	tw  *tar.Writer
+	cnt *countingWriter
+}
+
+// NewTarArchiver 基于给定的底层写入器创建一个TarArchiver。
+func NewTarArchiver(w io.Writer) *TarArchiver {
+	cnt := &countingWriter{w: w}
+	return &TarArchiver{tw: tar.NewWriter(cnt), cnt: cnt}
+}
+
+func (a *TarArchiver) AddFile(zipPath string, info os.FileInfo, r io.Reader) (int64, error) {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return 0, fmt.Errorf("无法获取tar文件头 %s: %w", zipPath, err)
+	}
+	header.Name = zipPath
+
+	if err := a.tw.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("无法写入tar文件头 %s: %w", header.Name, err)
+	}
+	offset := a.cnt.offset
+
+	if _, err := io.Copy(a.tw, r); err != nil {
+		return offset, fmt.Errorf("写入tar内容时出错 %s: %w", zipPath, err)
+	}
+	return offset, nil
+}
+
+func (a *TarArchiver) Close() error {
+	return a.tw.Close()
+}
+
+// countingWriter 包装一个io.Writer并累加写入的字节数，
+// 用于计算每个归档条目在底层流中的偏移量。
+type countingWriter struct {
+	w      io.Writer
+	offset int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.offset += int64(n)
+	return n, err
+}
+
+// ltfsFileEntry 描述一个等待写入LTFS归档的文件。
+type ltfsFileEntry struct {
+	absPath string
+	zipPath string
+	info    os.FileInfo
+}
+
+// ltfsManifestEntry 对应索引清单中的一个<file>节点。
+type ltfsManifestEntry struct {
+	Path    string `xml:"path"`
+	Offset  int64  `xml:"offset"`
+	Size    int64  `xml:"size"`
+	ModTime string `xml:"mtime"`
+	SHA256  string `xml:"sha256"`
+}
+
+// ltfsManifest 是写在destFile旁边的SnIA风格索引清单。
+type ltfsManifest struct {
+	XMLName xml.Name            `xml:"ltfsindex"`
+	Version string              `xml:"version,attr"`
+	Files   []ltfsManifestEntry `xml:"file"`
+}
+
+// writeLTFSArchive 扫描所有源路径，按文件大小从小到大排序后写入tar流，
+// 使得从磁带尾部开始的恢复操作只需要回放少量小文件。当writeManifest为
+// true时（-format=ltfs），额外在destFile旁生成SnIA风格的XML索引清单。
+func writeLTFSArchive(w io.Writer, sources []string, destFile string, writeManifest bool,
+	bar interface{ Add(int) error }, speedTracker *SpeedTracker, pauseController *PauseController,
+	currentFile *atomic.Value) error {
+
+	var entries []ltfsFileEntry
+
+	for _, source := range sources {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Printf("访问 %s 时发生错误: %v", path, err)
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				log.Printf("无法获取绝对路径 %s: %v", path, err)
+				return nil
+			}
+			_, zipPath := archivePathFor(absPath)
+			if zipPath == "" || zipPath == "." {
+				return nil
+			}
+			entries = append(entries, ltfsFileEntry{absPath: absPath, zipPath: zipPath, info: info})
+			return nil
+		})
+		if err != nil {
+			log.Printf("错误: 扫描文件 '%s' 时出错: %v", source, err)
+		}
+	}
+
+	// 小文件在前，大文件在后，便于从磁带尾部做廉价的seek-to-end恢复。
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].info.Size() < entries[j].info.Size()
+	})
+
+	archiver := NewTarArchiver(w)
+	manifest := ltfsManifest{Version: "1.0"}
+
+	for _, e := range entries {
+		pauseController.WaitIfPaused()
+		currentFile.Store(filepath.Base(e.absPath))
+
+		file, err := os.Open(e.absPath)
+		if err != nil {
+			log.Printf("无法打开文件 %s: %v", e.absPath, err)
+			continue
+		}
+
+		hasher := sha256.New()
+		progressReader := &hashingProgressReader{
+			r:      file,
+			hasher: hasher,
+			bar:    bar,
+			speed:  speedTracker,
+			pause:  pauseController,
+		}
+
+		offset, err := archiver.AddFile(e.zipPath, e.info, progressReader)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, ltfsManifestEntry{
+			Path:    e.zipPath,
+			Offset:  offset,
+			Size:    e.info.Size(),
+			ModTime: e.info.ModTime().UTC().Format(time.RFC3339),
+			SHA256:  hex.EncodeToString(hasher.Sum(nil)),
+		})
+	}
+
+	if err := archiver.Close(); err != nil {
+		return fmt.Errorf("无法关闭tar写入器: %w", err)
+	}
+
+	if writeManifest {
+		out, err := xml.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return fmt.Errorf("无法序列化LTFS索引清单: %w", err)
+		}
+		sidecar := destFile + ".index.xml"
+		content := append([]byte(xml.Header), out...)
+		if err := os.WriteFile(sidecar, content, 0644); err != nil {
+			log.Printf("警告: 无法写入LTFS索引清单 %s: %v", sidecar, err)
+		} else {
+			log.Printf("LTFS索引清单已保存到: %s", sidecar)
+		}
+	}
+
+	return nil
+}
+
+// hashingProgressReader 在读取文件内容的同时更新SHA256、进度条与速度统计，
+// 供writeLTFSArchive逐文件写入时复用。
+type hashingProgressReader struct {
+	r      io.Reader
+	hasher io.Writer
+	bar    interface{ Add(int) error }
+	speed  *SpeedTracker
+	pause  *PauseController
+}
+
+func (h *hashingProgressReader) Read(p []byte) (int, error) {
+	h.pause.WaitIfPaused()
+	n, err := h.r.Read(p)
+	if n > 0 {
+		h.hasher.Write(p[:n])
+		h.bar.Add(n)
+		h.speed.Update(int64(n))
+	}
+	return n, err
+}
@@ -3,11 +3,8 @@ package main
 import (
 	"archive/zip"
 	"bufio"
-	"crypto/sha256"
-	"encoding/hex"
 	"flag"
 	"fmt"
-	"hash"
 	"io"
 	"log"
 	"os"
@@ -164,99 +161,6 @@ func (bw *BufferedWriter) Flush() error {
 	return err
 }
 
-// AsyncSHA256Writer 在单独的goroutine中异步计算SHA256哈希值
-type AsyncSHA256Writer struct {
-	writer   io.Writer
-	hasher   hash.Hash
-	dataCh   chan []byte
-	doneCh   chan struct{}
-	resultCh chan string
-	wg       sync.WaitGroup
-	mu       sync.Mutex
-	closed   bool
-}
-
-func NewAsyncSHA256Writer(writer io.Writer) *AsyncSHA256Writer {
-	asw := &AsyncSHA256Writer{
-		writer:   writer,
-		hasher:   sha256.New(),
-		dataCh:   make(chan []byte, 10), // 缓冲通道提高性能
-		doneCh:   make(chan struct{}),
-		resultCh: make(chan string, 1),
-	}
-
-	// 启动哈希计算goroutine
-	asw.wg.Add(1)
-	go asw.hashWorker()
-
-	return asw
-}
-
-func (asw *AsyncSHA256Writer) hashWorker() {
-	defer asw.wg.Done()
-
-	for {
-		select {
-		case data := <-asw.dataCh:
-			if data == nil {
-				// 收到结束信号
-				asw.resultCh <- hex.EncodeToString(asw.hasher.Sum(nil))
-				return
-			}
-			asw.hasher.Write(data)
-		case <-asw.doneCh:
-			// 强制结束
-			return
-		}
-	}
-}
-
-func (asw *AsyncSHA256Writer) Write(p []byte) (n int, err error) {
-	// 先写入到目标writer
-	n, err = asw.writer.Write(p)
-	if err != nil {
-		return n, err
-	}
-
-	// 异步发送数据给哈希计算器
-	asw.mu.Lock()
-	if !asw.closed && n > 0 {
-		// 创建数据副本以避免竞态条件
-		dataCopy := make([]byte, n)
-		copy(dataCopy, p[:n])
-
-		// 阻塞等待直到数据被发送到通道
-		asw.dataCh <- dataCopy
-	}
-	asw.mu.Unlock()
-
-	return n, nil
-}
-
-func (asw *AsyncSHA256Writer) Close() {
-	asw.mu.Lock()
-	if !asw.closed {
-		asw.closed = true
-		// 发送结束信号
-		asw.dataCh <- nil
-	}
-	asw.mu.Unlock()
-}
-
-func (asw *AsyncSHA256Writer) Sum() string {
-	asw.Close()
-
-	// 等待哈希计算完成
-	select {
-	case result := <-asw.resultCh:
-		return result
-	case <-time.After(30 * time.Second): // 超时保护
-		close(asw.doneCh)
-		asw.wg.Wait()
-		return ""
-	}
-}
-
 // readLines 从指定文件中读取所有行，并去除每行首尾的引号和空白
 func readLines(path string) ([]string, error) {
 	file, err := os.Open(path)
@@ -278,10 +182,63 @@ func readLines(path string) ([]string, error) {
 }
 
 func main() {
+	// verify是一个独立子命令，必须在主flag.Parse()之前分流，
+	// 否则"verify"会被当成一个位置参数传给压缩流程处理。
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		runVerify(os.Args[2:])
+		return
+	}
+
 	var noSha256 bool
-	flag.BoolVar(&noSha256, "n", false, "跳过SHA256计算")
+	var format string
+	var jobs int
+	var levelFlag string
+	var resume bool
+	var hashFlag string
+	var splitSizeFlag string
+	flag.BoolVar(&noSha256, "n", false, "跳过哈希计算（等价于 -hash= 空列表）")
+	flag.StringVar(&format, "format", "zip", "输出格式: zip, tar 或 ltfs（LTFS模式会按文件大小排序并生成XML索引清单）")
+	flag.IntVar(&jobs, "j", 1, "zip模式下并行压缩文件所使用的worker数量")
+	flag.StringVar(&levelFlag, "level", "store", "zip模式下的压缩级别: 0-9 或 store（不压缩，默认）")
+	flag.BoolVar(&resume, "resume", false, "从上次中断处续传（需要目标文件和对应的.manifest断点清单均存在，目前仅支持-format=zip）")
+	flag.StringVar(&hashFlag, "hash", "sha256", "以逗号分隔的哈希算法列表，可选: md5,crc32,sha1,sha256,sha512,blake3")
+	flag.StringVar(&splitSizeFlag, "split-size", "0", "按给定大小分卷输出，如 5GiB、100MB（默认0表示不分卷；-format=zip时卷文件命名为dest.z01、dest.z02...、末卷即dest本身，可直接被unzip/7z读取）")
 	flag.Parse()
 
+	switch format {
+	case "zip", "tar", "ltfs":
+	default:
+		log.Fatalf("错误: 不支持的 -format 取值 %q，可选值为 zip、tar、ltfs", format)
+	}
+
+	level, err := parseCompressLevel(levelFlag)
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+
+	splitSize, err := parseSplitSize(splitSizeFlag)
+	if err != nil {
+		log.Fatalf("错误: %v", err)
+	}
+	if splitSize > 0 && resume {
+		log.Printf("提示: -resume 暂不支持与 -split-size 同时使用，本次已忽略 -resume。")
+		resume = false
+	}
+
+	var hashAlgos []string
+	if !noSha256 {
+		for _, a := range strings.Split(hashFlag, ",") {
+			a = strings.TrimSpace(a)
+			if a == "" {
+				continue
+			}
+			if _, verr := newHasher(a); verr != nil {
+				log.Fatalf("错误: %v", verr)
+			}
+			hashAlgos = append(hashAlgos, a)
+		}
+	}
+
 	// 记录开始时间
 	startTime := time.Now()
 
@@ -352,15 +309,79 @@ func main() {
 	}
 	log.Printf("扫描完成。共找到 %d 个文件, 总大小 %.2f MB\n", totalFiles, float64(totalSize)/1024/1024)
 
+	// zip格式的32位上限：单个条目大小、归档总大小或文件数超过阈值时，
+	// archive/zip会强制为相关条目及中央目录/EOCD写入Zip64扩展结构，
+	// 并非可选项——这里打印的日志只是告知用户这一事实已经被触发。
+	const zip64SizeThreshold = 1<<32 - 1
+	const zip64CountThreshold = 1<<16 - 1
+	if format == "zip" && (totalSize > zip64SizeThreshold || totalFiles > zip64CountThreshold) {
+		log.Printf("提示: 总大小或文件数已超过32位zip格式上限，本次归档将强制使用Zip64扩展头。")
+	}
+
 	// --- 阶段 2: 执行压缩并显示进度条 ---
 	log.Println("阶段 2/2: 开始压缩文件...")
 	log.Println("提示: 按回车键可以暂停/继续压缩过程")
 
-	file, err := os.Create(destFile)
-	if err != nil {
-		log.Fatalf("错误: 无法创建目标文件 %s: %v", destFile, err)
+	// 检测是否可以从上一次中断处续传：要求目标文件和断点清单均已存在。
+	var resumeEntries []ManifestEntry
+	var resumeOffset int64
+	resumeActive := false
+	if resume {
+		if format != "zip" {
+			log.Printf("提示: -resume 目前仅支持 -format=zip，本次已忽略该选项。")
+		} else if _, statErr := os.Stat(destFile); statErr == nil {
+			if _, mErr := os.Stat(manifestPath(destFile)); mErr == nil {
+				entries, lerr := loadManifest(manifestPath(destFile))
+				if lerr != nil {
+					log.Printf("警告: 无法读取断点清单 %s，将重新开始: %v", manifestPath(destFile), lerr)
+				} else if len(entries) > 0 {
+					resumeEntries = entries
+					resumeOffset = entries[len(entries)-1].EndOffset
+					resumeActive = true
+					log.Printf("检测到断点清单，已归档 %d 个文件，将从偏移量 %d 续传。", len(entries), resumeOffset)
+				}
+			}
+		}
+	}
+
+	var file *os.File
+	var splitWriter *SplitWriter
+	if splitSize > 0 {
+		// 分卷模式下实际数据先写入destFile.z01、destFile.z02...，由
+		// SplitWriter按-split-size自动切卷；-format=zip时末卷会在Close时
+		// 被重命名为destFile本身，并修正其中的跨卷磁盘号字段。
+		sw, serr := NewSplitWriter(destFile, splitSize, format == "zip")
+		if serr != nil {
+			log.Fatalf("错误: 无法创建分卷输出: %v", serr)
+		}
+		splitWriter = sw
+	} else {
+		if resumeActive {
+			file, err = os.OpenFile(destFile, os.O_RDWR, 0644)
+		} else {
+			file, err = os.Create(destFile)
+		}
+		if err != nil {
+			log.Fatalf("错误: 无法打开目标文件 %s: %v", destFile, err)
+		}
+		defer file.Close()
+	}
+
+	// 截断掉续传偏移量之后可能残留的不完整数据；各哈希算法的滚动状态会在
+	// 下方创建AsyncHashWriter时从目标文件的前resumeOffset字节回放得到。
+	if resumeActive {
+		if err := file.Truncate(resumeOffset); err != nil {
+			log.Fatalf("错误: 无法截断目标文件到续传偏移量 %d: %v", resumeOffset, err)
+		}
+		if _, err := file.Seek(resumeOffset, io.SeekStart); err != nil {
+			log.Fatalf("错误: 无法定位到续传偏移量 %d: %v", resumeOffset, err)
+		}
+	}
+
+	var destWriter io.Writer = file
+	if splitWriter != nil {
+		destWriter = splitWriter
 	}
-	defer file.Close()
 
 	// 初始化暂停控制器
 	pauseController := NewPauseController()
@@ -450,48 +471,186 @@ func main() {
 		}
 	}()
 
-	// 根据是否需要计算SHA256选择写入器
+	// 根据所选的哈希算法列表选择写入器
 	var finalWriter io.Writer
-	var sha256Writer *AsyncSHA256Writer
-
-	if noSha256 {
-		finalWriter = file
+	var hashWriter *AsyncHashWriter
+
+	if len(hashAlgos) == 0 {
+		finalWriter = destWriter
+	} else if resumeActive {
+		seedFile, serr := os.Open(destFile)
+		if serr != nil {
+			log.Fatalf("错误: 无法打开目标文件以回放哈希状态: %v", serr)
+		}
+		hw, herr := NewAsyncHashWriterResumed(destWriter, hashAlgos, seedFile, resumeOffset)
+		seedFile.Close()
+		if herr != nil {
+			log.Fatalf("错误: %v", herr)
+		}
+		hashWriter = hw
+		finalWriter = hashWriter
 	} else {
-		sha256Writer = NewAsyncSHA256Writer(file)
-		finalWriter = sha256Writer
+		hw, herr := NewAsyncHashWriter(destWriter, hashAlgos)
+		if herr != nil {
+			log.Fatalf("错误: %v", herr)
+		}
+		hashWriter = hw
+		finalWriter = hashWriter
 	}
 
 	// 创建带缓冲的文件写入器
 	bufferedFile := NewBufferedWriter(finalWriter, 10*1024*1024) // 10MB buffer
 
-	// 创建 Zip Writer
-	zipWriter := zip.NewWriter(bufferedFile)
-	defer func() {
+	if format == "zip" {
+		// 用一个计数写入器包住bufferedFile，以便记录断点清单中每个条目
+		// 在归档字节流中的精确偏移量；断点续传时从上次的续传偏移量续记。
+		countedWriter := &countingWriter{w: bufferedFile, offset: resumeOffset}
+
+		// 创建 Zip Writer
+		zipWriter := zip.NewWriter(countedWriter)
+		if resumeActive {
+			zipWriter.SetOffset(resumeOffset)
+		}
+		defer func() {
+			zipWriter.Close()
+			bufferedFile.Flush()
+		}()
+
+		// 用于跟踪已经创建的卷根目录
+		createdVolumes := make(map[string]bool)
+
+		// 断点续传清单：每成功写入一个文件条目就追加一行JSON记录，
+		// 使后续-resume可以跳过已完成的文件并从正确的偏移量续传。
+		mw, mErr := newManifestWriter(manifestPath(destFile), resumeActive)
+		if mErr != nil {
+			log.Fatalf("错误: 无法打开断点清单 %s: %v", manifestPath(destFile), mErr)
+		}
+
+		var skipPaths map[string]bool
+		if resumeActive {
+			skipPaths = make(map[string]bool, len(resumeEntries))
+			for _, e := range resumeEntries {
+				skipPaths[e.AbsPath] = true
+			}
+		}
+
+		// 遍历所有源，将它们添加到zip中
+		for _, source := range sources {
+			before := countedWriter.offset
+			recordCheckpoint := func(r pipelineResult) error {
+				// zip.Writer 内部带有自己的bufio.Writer，CreateRaw写入的字节
+				// 在其填满前不会转交给countedWriter，此时读取的offset会落后于
+				// 该条目的真实归档位置；必须先Flush让本地缓冲吐出数据，
+				// offset才是该条目真实的结束偏移量。
+				if err := zipWriter.Flush(); err != nil {
+					return fmt.Errorf("刷新zip写入器失败: %w", err)
+				}
+				end := countedWriter.offset
+				if err := bufferedFile.Flush(); err != nil {
+					return fmt.Errorf("续传落盘失败: %w", err)
+				}
+				// 目录条目不写入断点清单（续传靠AbsPath跳过的只有文件），
+				// 但写入游标必须照样前进，否则下一个文件记录到的StartOffset
+				// 会漏算目录条目的本地文件头，指向错误的位置。
+				if r.absPath == "" {
+					before = end
+					return nil
+				}
+				entry := ManifestEntry{
+					AbsPath:        r.absPath,
+					ZipPath:        r.header.Name,
+					Size:           int64(r.header.UncompressedSize64),
+					ModTime:        r.header.Modified,
+					CRC32:          r.header.CRC32,
+					StartOffset:    before,
+					EndOffset:      end,
+					Method:         r.header.Method,
+					CompressedSize: int64(r.header.CompressedSize64),
+					ExternalAttrs:  r.header.ExternalAttrs,
+					Hashes:         r.hashes,
+				}
+				before = end
+				return mw.Record(entry)
+			}
+			if err := addFilesParallel(zipWriter, source, bar, speedTracker, pauseController, &currentFile, createdVolumes, jobs, level, hashAlgos, skipPaths, recordCheckpoint); err != nil {
+				done <- true // 发生错误，通知更新 goroutine 停止
+				// 在新行打印错误，避免与进度条混淆
+				fmt.Fprintf(os.Stderr, "\n")
+				log.Fatalf("错误: 压缩 '%s' 过程中发生错误: %v", source, err)
+			}
+		}
+
+		// 分卷模式下，中央目录与EOCD需要完整落在独立的一卷里才能在Close
+		// 时被准确地修正跨卷磁盘号：先把此前所有数据经由zipWriter自身的
+		// 缓冲和bufferedFile彻底落盘到当前卷，再强制切到下一卷。
+		if splitWriter != nil {
+			if err := zipWriter.Flush(); err != nil {
+				log.Fatalf("错误: 无法刷新zip写入器: %v", err)
+			}
+			if err := bufferedFile.Flush(); err != nil {
+				log.Fatalf("错误: 无法刷新缓冲写入器: %v", err)
+			}
+			if err := splitWriter.ForceRotate(); err != nil {
+				log.Fatalf("错误: 无法为中央目录切换分卷: %v", err)
+			}
+		}
+
+		// 确保所有数据都被刷新到文件
 		zipWriter.Close()
 		bufferedFile.Flush()
-	}()
 
-	// 用于跟踪已经创建的卷根目录
-	createdVolumes := make(map[string]bool)
-
-	// 遍历所有源，将它们添加到zip中
-	for _, source := range sources {
-		if err := addFiles(zipWriter, source, bar, speedTracker, pauseController, &currentFile, createdVolumes); err != nil {
-			done <- true // 发生错误，通知更新 goroutine 停止
-			// 在新行打印错误，避免与进度条混淆
+		// 归档成功完成后保留断点清单：除了支持下一次-resume外，
+		// 它也是verify子命令核对每个条目哈希的依据。
+		mw.Close()
+
+		// resumeEntries是续传前已经写入目标文件、但本次会话的zipWriter
+		// 对其一无所知的条目：上面Close()写出的中央目录只覆盖了本次
+		// 新写的文件，必须把它们的中央目录记录补回去，否则任何标准zip
+		// reader打开归档时都看不到它们（分卷模式下中央目录由SplitWriter
+		// 在重命名末卷后另行处理，此处不需要、也无法定位resumeOffset
+		// 之前的字节在哪一卷里，暂不支持-resume与-split-size同时使用）。
+		if resumeActive && splitWriter == nil {
+			if err := replayResumeEntries(destFile, resumeEntries); err != nil {
+				log.Fatalf("错误: %v", err)
+			}
+		}
+	} else {
+		// tar/ltfs模式：按文件大小升序排列后写入tar流，
+		// 保证从归档尾部开始的磁带检索总是先遇到小文件。
+		if err := writeLTFSArchive(bufferedFile, sources, destFile, format == "ltfs", bar, speedTracker, pauseController, &currentFile); err != nil {
+			done <- true
 			fmt.Fprintf(os.Stderr, "\n")
-			log.Fatalf("错误: 压缩 '%s' 过程中发生错误: %v", source, err)
+			log.Fatalf("错误: 生成LTFS归档时发生错误: %v", err)
 		}
+		bufferedFile.Flush()
 	}
 
-	// 确保所有数据都被刷新到文件
-	zipWriter.Close()
-	bufferedFile.Flush()
+	// 分卷模式下，最后一卷的末尾就是zip.Writer写入的EOCD所在位置；
+	// 关闭SplitWriter以落盘最后一卷并取回每一卷各自的SHA256摘要。
+	var volumeDigests []VolumeDigest
+	if splitWriter != nil {
+		vd, verr := splitWriter.Close()
+		if verr != nil {
+			log.Fatalf("错误: 无法关闭分卷输出: %v", verr)
+		}
+		volumeDigests = vd
+	}
 
-	// 获取计算出的SHA256值
-	var sha256Sum string
-	if !noSha256 && sha256Writer != nil {
-		sha256Sum = sha256Writer.Sum()
+	// 获取计算出的各算法哈希值
+	var sums map[string]string
+	if hashWriter != nil {
+		sums = hashWriter.Sums()
+	}
+	// replayResumeEntries会把续传前条目的中央目录记录插回归档中间，插入点
+	// 之后的字节布局已经和hashWriter增量计算时见过的字节流不一样了，滚动
+	// 哈希没法在文件中间插入字节后继续保持有效，因此要整份重新计算一次。
+	if resumeActive && splitWriter == nil && len(resumeEntries) > 0 && len(sums) > 0 {
+		resumed, rerr := recomputeWholeFileHashes(destFile, hashAlgos)
+		if rerr != nil {
+			log.Printf("警告: 回放续传前中央目录记录后重新计算校验和失败，.sha256/.hashes可能与归档不符: %v", rerr)
+		} else {
+			sums = resumed
+		}
 	}
 
 	done <- true // 通知进度条更新 goroutine 退出
@@ -501,121 +660,65 @@ func main() {
 	duration := time.Since(startTime)
 	log.Printf("压缩完成。总共用时: %.2f 秒", duration.Seconds())
 
-	if !noSha256 {
-		if sha256Sum != "" {
-			log.Printf("SHA256 校验和: %s", sha256Sum)
+	if len(sums) > 0 {
+		baseName := filepath.Base(destFile)
 
-			// 将SHA256写入到同名的.sha256文件中
+		// 为保持向后兼容，sha256单独保留一份.sha256文件
+		if sum, ok := sums["sha256"]; ok && sum != "" {
+			log.Printf("SHA256 校验和: %s", sum)
 			sha256File := destFile + ".sha256"
-			if err := os.WriteFile(sha256File, []byte(sha256Sum+"  "+filepath.Base(destFile)+"\n"), 0644); err != nil {
+			if err := os.WriteFile(sha256File, []byte(sum+"  "+baseName+"\n"), 0644); err != nil {
 				log.Printf("警告: 无法写入SHA256文件 %s: %v", sha256File, err)
 			} else {
 				log.Printf("SHA256校验和已保存到: %s", sha256File)
 			}
-		} else {
-			log.Printf("警告: SHA256计算超时或失败")
 		}
-	}
-}
-
-// addFiles 遍历路径并将其中的文件和目录添加到zip.Writer中
-func addFiles(w *zip.Writer, basePath string, bar *progressbar.ProgressBar,
-	speedTracker *SpeedTracker, pauseController *PauseController, currentFile *atomic.Value,
-	createdVolumes map[string]bool) error {
-
-	copyBuffer := make([]byte, 5*1024*1024) // 5MB缓冲区
 
-	return filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("访问 %s 时发生错误: %v", path, err)
-			return nil // 继续处理其他文件
+		// 所有算法合并写入destFile.hashes，每种算法一行sha256sum兼容格式
+		var sb strings.Builder
+		for _, algo := range hashAlgos {
+			sum, ok := sums[algo]
+			if !ok || sum == "" {
+				log.Printf("警告: %s 计算超时或失败", algo)
+				continue
+			}
+			fmt.Fprintf(&sb, "# algorithm: %s\n%s  %s\n", algo, sum, baseName)
 		}
-
-		pauseController.WaitIfPaused()
-
-		// 更新当前正在处理的文件名，供进度条显示
-		currentFile.Store(filepath.Base(path))
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			log.Printf("无法获取文件头信息 %s: %v", path, err)
-			return nil // 继续处理其他文件
+		hashesFile := destFile + ".hashes"
+		if err := os.WriteFile(hashesFile, []byte(sb.String()), 0644); err != nil {
+			log.Printf("警告: 无法写入哈希清单文件 %s: %v", hashesFile, err)
+		} else {
+			log.Printf("哈希清单已保存到: %s", hashesFile)
 		}
+	}
 
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			log.Printf("无法获取绝对路径 %s: %v", path, err)
-			return nil
+	// 分卷模式下额外记录每一卷各自的SHA256，格式与.sha256/.hashes一致，
+	// 便于拼接前逐卷校验传输是否完整。
+	if len(volumeDigests) > 0 {
+		var sb strings.Builder
+		for _, vd := range volumeDigests {
+			fmt.Fprintf(&sb, "%s  %s\n", vd.SHA256, vd.Name)
 		}
-		volumeName := filepath.VolumeName(absPath)         // e.g., "C:"
-		driveLetter := strings.TrimSuffix(volumeName, ":") // e.g., "C"
-
-		// 创建卷的根目录 (e.g., "C/")，仅创建一次
-		if driveLetter != "" && !createdVolumes[driveLetter] {
-			// 创建一个虚拟的 FileInfo 用于 FileInfoHeader
-			volHeader, _ := zip.FileInfoHeader(info)
-			volHeader.Name = driveLetter + "/"
-			volHeader.Method = zip.Store
-			if _, err := w.CreateHeader(volHeader); err != nil {
-				log.Printf("无法为卷创建目录 %s: %v", volHeader.Name, err)
-			}
-			createdVolumes[driveLetter] = true
-		}
-
-		// 从绝对路径中移除卷名和前导分隔符
-		pathWithoutVolume := strings.TrimPrefix(absPath, volumeName)
-		pathWithoutVolume = strings.TrimPrefix(pathWithoutVolume, string(os.PathSeparator))
-
-		// 将盘符和剩余路径结合起来
-		zipPath := filepath.Join(driveLetter, pathWithoutVolume)
-
-		// 如果zipPath为空（例如，当path和baseDir相同时），则跳过
-		if zipPath == "" || zipPath == "." {
-			return nil
+		volumesFile := destFile + ".volumes.sha256"
+		if err := os.WriteFile(volumesFile, []byte(sb.String()), 0644); err != nil {
+			log.Printf("警告: 无法写入分卷校验和文件 %s: %v", volumesFile, err)
+		} else {
+			log.Printf("分卷校验和已保存到: %s", volumesFile)
 		}
+	}
+}
 
-		header.Name = filepath.ToSlash(zipPath)
-		header.Method = zip.Store // 不压缩
-
-		if info.IsDir() {
-			header.Name += "/"
-		}
+// archivePathFor 根据绝对路径计算归档内使用的盘符与相对路径，
+// 供zip和LTFS两种归档方式共用，以保持盘符布局一致。
+func archivePathFor(absPath string) (driveLetter string, zipPath string) {
+	volumeName := filepath.VolumeName(absPath)        // e.g., "C:"
+	driveLetter = strings.TrimSuffix(volumeName, ":") // e.g., "C"
 
-		writer, err := w.CreateHeader(header)
-		if err != nil {
-			log.Printf("无法在zip中创建文件头 %s: %v", header.Name, err)
-			return nil
-		}
+	// 从绝对路径中移除卷名和前导分隔符
+	pathWithoutVolume := strings.TrimPrefix(absPath, volumeName)
+	pathWithoutVolume = strings.TrimPrefix(pathWithoutVolume, string(os.PathSeparator))
 
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				log.Printf("无法打开文件 %s: %v", path, err)
-				return nil
-			}
-			defer file.Close()
-
-			for {
-				pauseController.WaitIfPaused()
-
-				n, readErr := file.Read(copyBuffer)
-				if n > 0 {
-					if _, writeErr := writer.Write(copyBuffer[:n]); writeErr != nil {
-						log.Printf("写入zip文件时出错 %s: %v", path, writeErr)
-						return nil
-					}
-					bar.Add(n)
-					speedTracker.Update(int64(n))
-				}
-				if readErr != nil {
-					if readErr == io.EOF {
-						break
-					}
-					log.Printf("读取文件时出错 %s: %v", path, readErr)
-					return nil
-				}
-			}
-		}
-		return nil
-	})
+	// 将盘符和剩余路径结合起来
+	zipPath = filepath.ToSlash(filepath.Join(driveLetter, pathWithoutVolume))
+	return driveLetter, zipPath
 }
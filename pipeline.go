@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// compressLevelStore 是-level参数的特殊取值"store"对应的内部级别，
+// 表示完全不压缩（对应zip.Store）。
+const compressLevelStore = -100
+
+// parseCompressLevel 将-level参数解析为flate压缩级别；"store"表示不压缩。
+func parseCompressLevel(s string) (int, error) {
+	if s == "store" {
+		return compressLevelStore, nil
+	}
+	lvl, err := strconv.Atoi(s)
+	if err != nil || lvl < 0 || lvl > 9 {
+		return 0, fmt.Errorf("无效的 -level 取值 %q，可选 0-9 或 store", s)
+	}
+	return lvl, nil
+}
+
+// pipelineJob 是工作池要处理的一个归档条目：普通文件、目录或卷根目录占位项。
+type pipelineJob struct {
+	index    int
+	zipPath  string
+	info     os.FileInfo
+	absPath  string
+	isVolume bool
+}
+
+// pipelineResult 是工作协程为某个条目生成的结果，携带其原始遍历顺序中的
+// index，以便序列化协程按顺序写回，保持归档布局确定。
+type pipelineResult struct {
+	index   int
+	header  *zip.FileHeader
+	data    []byte
+	absPath string            // 仅对普通文件设置，供断点续传清单记录
+	hashes  map[string]string // 按-hash列出的算法计算出的该文件哈希值
+	failed  bool              // compressJob处理该条目失败，序列化协程应跳过而非写入
+}
+
+// addFilesParallel 遍历basePath下的所有文件，用numWorkers个协程并行读取并用
+// flate压缩每个文件，再由一个串行协程按原始遍历顺序调用zip.Writer.CreateRaw
+// 写入，从而在获得并行压缩收益的同时保持归档条目顺序确定，使AsyncSHA256Writer
+// 看到的仍是最终归档顺序下的字节流。
+//
+// skipPaths非nil时表示处于-resume续传模式：其中列出的绝对路径视为已经
+// 归档完毕，本次遍历会跳过它们；checkpoint非nil时，每成功写入一个条目
+// （包括目录条目）就会调用一次，用于落盘断点清单并推进写入偏移量游标——
+// 调用方需要自行根据r.absPath是否为空区分真正的文件条目和目录条目。
+func addFilesParallel(w *zip.Writer, basePath string, bar *progressbar.ProgressBar,
+	speedTracker *SpeedTracker, pauseController *PauseController, currentFile *atomic.Value,
+	createdVolumes map[string]bool, numWorkers int, level int, hashAlgos []string,
+	skipPaths map[string]bool, checkpoint func(pipelineResult) error) error {
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	var jobs []pipelineJob
+	err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("访问 %s 时发生错误: %v", path, err)
+			return nil
+		}
+
+		absPath, aerr := filepath.Abs(path)
+		if aerr != nil {
+			log.Printf("无法获取绝对路径 %s: %v", path, aerr)
+			return nil
+		}
+		driveLetter, zipPath := archivePathFor(absPath)
+
+		// 创建卷的根目录 (e.g., "C/")，仅创建一次
+		if driveLetter != "" && !createdVolumes[driveLetter] {
+			jobs = append(jobs, pipelineJob{zipPath: driveLetter + "/", info: info, isVolume: true})
+			createdVolumes[driveLetter] = true
+		}
+
+		if zipPath == "" || zipPath == "." {
+			return nil
+		}
+
+		if !info.IsDir() && skipPaths != nil {
+			if skipPaths[absPath] {
+				log.Printf("续传: 跳过已归档文件 %s", absPath)
+				return nil
+			}
+			log.Printf("续传: 发现新文件 %s，将加入本次归档", absPath)
+		}
+
+		name := zipPath
+		if info.IsDir() {
+			name += "/"
+		}
+		jobs = append(jobs, pipelineJob{zipPath: name, info: info, absPath: absPath})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		jobs[i].index = i
+	}
+
+	jobCh := make(chan pipelineJob)
+	resultCh := make(chan pipelineResult, numWorkers)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				res, jerr := compressJob(job, level, hashAlgos, bar, speedTracker, pauseController, currentFile)
+				if jerr != nil {
+					log.Printf("处理归档条目 %s 时出错，已跳过: %v", job.zipPath, jerr)
+					resultCh <- pipelineResult{index: job.index, failed: true}
+					continue
+				}
+				resultCh <- res
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobCh <- job
+		}
+		close(jobCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	// 序列化协程：用一个缓冲区把乱序到达的压缩结果按index重新排序后
+	// 依次写入zip.Writer，保证归档条目顺序与原始遍历顺序一致。失败的条目
+	// (failed=true) 不写入，但仍然占据其index，从而保证next能继续前进，
+	// 不让后面已经处理好的条目因为一个坏条目而永久卡在pending里。
+	pending := make(map[int]pipelineResult)
+	next := 0
+	for res := range resultCh {
+		pending[res.index] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			if !r.failed {
+				if err := writeRawEntry(w, r); err != nil {
+					return err
+				}
+				// checkpoint对每个成功写入的条目都会被调用一次，哪怕是目录
+				// 条目（r.absPath==""，调用方应忽略、只把它当作让写入游标
+				// 前进的信号）：断点清单只记录文件，但写入偏移量的推进不能
+				// 漏掉目录条目，否则下一个文件记录到的StartOffset会跳过
+				// 目录条目的本地文件头，指向错误的位置。
+				if checkpoint != nil {
+					if err := checkpoint(r); err != nil {
+						return err
+					}
+				}
+			}
+			delete(pending, next)
+			next++
+		}
+	}
+
+	return nil
+}
+
+// compressJob 读取单个文件并按level压缩（或直接Store），返回可供
+// zip.Writer.CreateRaw直接写入的已完成条目；同时按hashAlgos计算该文件的
+// 多算法哈希值，供verify子命令核对单个文件而无需重读整个归档。
+func compressJob(job pipelineJob, level int, hashAlgos []string, bar *progressbar.ProgressBar, speedTracker *SpeedTracker,
+	pauseController *PauseController, currentFile *atomic.Value) (pipelineResult, error) {
+
+	pauseController.WaitIfPaused()
+
+	if job.isVolume {
+		header := &zip.FileHeader{Name: job.zipPath, Method: zip.Store}
+		header.SetModTime(job.info.ModTime())
+		return pipelineResult{index: job.index, header: header}, nil
+	}
+
+	header, err := zip.FileInfoHeader(job.info)
+	if err != nil {
+		return pipelineResult{}, fmt.Errorf("无法获取文件头信息 %s: %w", job.zipPath, err)
+	}
+	header.Name = job.zipPath
+
+	if job.info.IsDir() {
+		header.Method = zip.Store
+		// zip.FileInfoHeader填入的是目录本身的inode大小(如ext4/xfs上的4096)，
+		// 而目录条目实际不携带任何数据；CreateRaw不会像baseline用的
+		// CreateHeader那样自动把目录的大小清零，这里需要手动清零，否则
+		// unzip -t会报ucsize/csize与STORED条目实际0字节内容不符。
+		header.UncompressedSize64 = 0
+		header.CompressedSize64 = 0
+		header.CRC32 = 0
+		return pipelineResult{index: job.index, header: header}, nil
+	}
+
+	currentFile.Store(filepath.Base(job.absPath))
+
+	f, err := os.Open(job.absPath)
+	if err != nil {
+		return pipelineResult{}, fmt.Errorf("无法打开文件 %s: %w", job.absPath, err)
+	}
+	defer f.Close()
+
+	fileHashers := make(map[string]hash.Hash, len(hashAlgos))
+	for _, algo := range hashAlgos {
+		h, herr := newHasher(algo)
+		if herr != nil {
+			continue
+		}
+		fileHashers[algo] = h
+	}
+
+	var buf bytes.Buffer
+	var fw *flate.Writer
+	if level == compressLevelStore {
+		header.Method = zip.Store
+	} else {
+		header.Method = zip.Deflate
+		w, ferr := flate.NewWriter(&buf, level)
+		if ferr != nil {
+			return pipelineResult{}, fmt.Errorf("无法创建flate压缩器: %w", ferr)
+		}
+		fw = w
+	}
+
+	// 按5MB分块读取源文件：既避免一次性把整个文件读入内存（tape规模归档
+	// 下-j个并发worker同时缓冲整个大文件会有OOM风险），也让暂停控制在
+	// 每个分块而非每个文件粒度上生效，保持与baseline的addFiles一致的
+	// 亚秒级暂停响应。
+	copyBuffer := make([]byte, 5*1024*1024)
+	crcHasher := crc32.NewIEEE()
+	var uncompressedSize uint64
+	for {
+		pauseController.WaitIfPaused()
+
+		n, readErr := f.Read(copyBuffer)
+		if n > 0 {
+			chunk := copyBuffer[:n]
+			crcHasher.Write(chunk)
+			for _, h := range fileHashers {
+				h.Write(chunk)
+			}
+			if fw != nil {
+				if _, werr := fw.Write(chunk); werr != nil {
+					return pipelineResult{}, fmt.Errorf("压缩数据时出错 %s: %w", job.zipPath, werr)
+				}
+			} else {
+				buf.Write(chunk)
+			}
+			uncompressedSize += uint64(n)
+			bar.Add(n)
+			speedTracker.Update(int64(n))
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				return pipelineResult{}, fmt.Errorf("读取文件时出错 %s: %w", job.absPath, readErr)
+			}
+			break
+		}
+	}
+	if fw != nil {
+		if werr := fw.Close(); werr != nil {
+			return pipelineResult{}, fmt.Errorf("关闭flate压缩器时出错 %s: %w", job.zipPath, werr)
+		}
+	}
+
+	header.CRC32 = crcHasher.Sum32()
+	header.UncompressedSize64 = uncompressedSize
+	header.CompressedSize64 = uint64(buf.Len())
+
+	var fileHashes map[string]string
+	if len(fileHashers) > 0 {
+		fileHashes = make(map[string]string, len(fileHashers))
+		for algo, h := range fileHashers {
+			fileHashes[algo] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	return pipelineResult{index: job.index, header: header, data: buf.Bytes(), absPath: job.absPath, hashes: fileHashes}, nil
+}
+
+// writeRawEntry 把一个已压缩好的条目通过CreateRaw写入zip.Writer，
+// 不再触发zip包内部的二次压缩。
+func writeRawEntry(w *zip.Writer, r pipelineResult) error {
+	rw, err := w.CreateRaw(r.header)
+	if err != nil {
+		return fmt.Errorf("无法创建归档条目 %s: %w", r.header.Name, err)
+	}
+	if len(r.data) > 0 {
+		if _, err := rw.Write(r.data); err != nil {
+			return fmt.Errorf("写入归档条目数据时出错 %s: %w", r.header.Name, err)
+		}
+	}
+	return nil
+}
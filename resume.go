@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ManifestEntry 是--resume断点清单中的一行记录，描述一个已经成功写入
+// 目标归档的文件条目，用于重启后跳过已完成的文件并恢复写入游标。
+// Method/CompressedSize/ExternalAttrs额外保留了重建该条目中央目录记录
+// 所需的全部字段，使续传完成后能把这些条目重新"回放"进新的zip.Writer，
+// 而不只是跳过已归档文件、恢复写入游标。
+type ManifestEntry struct {
+	AbsPath        string            `json:"abs_path"`
+	ZipPath        string            `json:"zip_path"`
+	Size           int64             `json:"size"`
+	ModTime        time.Time         `json:"mod_time"`
+	CRC32          uint32            `json:"crc32"`
+	StartOffset    int64             `json:"start_offset"`
+	EndOffset      int64             `json:"end_offset"`
+	Method         uint16            `json:"method"`
+	CompressedSize int64             `json:"compressed_size"`
+	ExternalAttrs  uint32            `json:"external_attrs"`
+	Hashes         map[string]string `json:"hashes,omitempty"`
+}
+
+// manifestPath 返回destFile对应的断点清单文件路径，与.sha256等
+// 附属文件的命名方式保持一致。
+func manifestPath(destFile string) string {
+	return destFile + ".manifest"
+}
+
+// loadManifest 按写入顺序读取已有的断点清单。
+func loadManifest(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var e ManifestEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("无法解析断点清单记录: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// manifestWriter 打开断点清单文件，每成功写入一个归档条目就记录一行
+// JSON，使得进程被中断后仍能据此续传。
+type manifestWriter struct {
+	f *os.File
+}
+
+// newManifestWriter打开path。append为true（即本次是-resume续传）时以追加
+// 模式打开，续接上一次的记录；否则说明这是一次全新的归档，旧清单如果还
+// 残留着上一次运行（很可能源集合已经变化）的条目，会让verify和下一次
+// -resume都对不上当前归档，因此直接截断重新开始。
+func newManifestWriter(path string, resumeAppend bool) (*manifestWriter, error) {
+	flags := os.O_CREATE | os.O_WRONLY
+	if resumeAppend {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestWriter{f: f}, nil
+}
+
+func (mw *manifestWriter) Record(e ManifestEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	_, err = mw.f.Write(line)
+	return err
+}
+
+func (mw *manifestWriter) Close() error {
+	return mw.f.Close()
+}
+
+// replayResumeEntries在续传归档写完之后，把resumeEntries（上一次运行中
+// 已经写入、但本次会话的zip.Writer对其一无所知的那些条目）的中央目录
+// 记录补回最终归档。
+//
+// zip.Writer只记得自己通过CreateRaw等方法创建过的条目：SetOffset(resumeOffset)
+// 只是让它把本次会话新写条目的本地文件头偏移量算对，并不会让它知道
+// resumeOffset之前还有别的条目。所以Close时写出的中央目录只覆盖了本次
+// 会话新增的文件——之前已经写好的本地文件头和数据仍然原封不动地躺在
+// 文件里，只是不再出现在任何标准reader能看到的中央目录中。
+//
+// 修复方式是在归档写完后重新打开它，定位中央目录的起始偏移量，为每个
+// resumeEntries条目用一个丢弃其本地文件头/数据的临时zip.Writer重新生成
+// 一条中央目录记录（复用标准库本身的编码逻辑，保证与真正由zip.Writer
+// 写出的记录字节级一致），把这些记录插到本次会话写出的中央目录之前，
+// 并相应地修正EOCD（及Zip64 EOCD）里的条目数与中央目录大小字段——
+// 中央目录的起始偏移量本身不变，因此无需触碰它之前的任何字节。
+func replayResumeEntries(destFile string, resumeEntries []ManifestEntry) error {
+	if len(resumeEntries) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(destFile, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("无法重新打开 %s 以回放续传前的中央目录记录: %w", destFile, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("无法获取 %s 的大小: %w", destFile, err)
+	}
+	size := fi.Size()
+
+	loc, err := locateCentralDirectory(f, size)
+	if err != nil {
+		return fmt.Errorf("无法定位 %s 的中央目录: %w", destFile, err)
+	}
+
+	var oldCD bytes.Buffer
+	for _, e := range resumeEntries {
+		rec, err := buildCentralDirRecord(e)
+		if err != nil {
+			return fmt.Errorf("无法为续传前条目 %s 重建中央目录记录: %w", e.ZipPath, err)
+		}
+		oldCD.Write(rec)
+	}
+
+	tail := make([]byte, size-loc.cdOffset)
+	if _, err := f.ReadAt(tail, loc.cdOffset); err != nil {
+		return fmt.Errorf("无法读取 %s 现有的中央目录与EOCD: %w", destFile, err)
+	}
+	if err := patchEOCDCounts(tail, loc, len(resumeEntries), oldCD.Len()); err != nil {
+		return fmt.Errorf("无法修正 %s 的EOCD条目数/大小字段: %w", destFile, err)
+	}
+
+	if err := f.Truncate(loc.cdOffset); err != nil {
+		return fmt.Errorf("无法在 %d 处截断 %s 以重写中央目录: %w", loc.cdOffset, destFile, err)
+	}
+	if _, err := f.WriteAt(oldCD.Bytes(), loc.cdOffset); err != nil {
+		return fmt.Errorf("无法写入回放的中央目录记录: %w", err)
+	}
+	if _, err := f.WriteAt(tail, loc.cdOffset+int64(oldCD.Len())); err != nil {
+		return fmt.Errorf("无法写回修正后的中央目录与EOCD: %w", err)
+	}
+
+	log.Printf("续传: 已把续传前的 %d 个文件条目的中央目录记录补回 %s", len(resumeEntries), destFile)
+	return nil
+}
+
+// buildCentralDirRecord为一条ManifestEntry重新生成中央目录记录字节。
+// 做法是用一个只写入内存缓冲区、随后整体丢弃的临时zip.Writer：
+// SetOffset(e.StartOffset)让它以为自己正从该条目真实的本地文件头偏移量
+// 开始写，CreateRaw按与当初完全相同的header重新写一份（本地文件头和
+// 压缩数据都只是临时占位，不会被使用），取其Close后产出的中央目录记录
+// 部分——这样字节编码与标准库原本会为该条目写出的记录完全一致，无需
+// 在这里手工还原zip格式里version/flags等全部细节。
+func buildCentralDirRecord(e ManifestEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.SetOffset(e.StartOffset)
+
+	header := &zip.FileHeader{
+		Name:               e.ZipPath,
+		Method:             e.Method,
+		CRC32:              e.CRC32,
+		UncompressedSize64: uint64(e.Size),
+		CompressedSize64:   uint64(e.CompressedSize),
+		ExternalAttrs:      e.ExternalAttrs,
+	}
+	// CreateRaw不像CreateHeader那样会把Modified换算成legacy的
+	// ModifiedDate/ModifiedTime DOS字段，需要显式SetModTime才能让重建出的
+	// 记录在这两个字段上与原本由zip.FileInfoHeader生成的记录保持一致。
+	header.SetModTime(e.ModTime)
+	w, err := zw.CreateRaw(header)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时条目: %w", err)
+	}
+	if e.CompressedSize > 0 {
+		if _, err := w.Write(make([]byte, e.CompressedSize)); err != nil {
+			return nil, fmt.Errorf("无法写入临时占位数据: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("无法关闭临时zip写入器: %w", err)
+	}
+
+	data := buf.Bytes()
+	sig := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sig, zipSigCentralDir)
+	idx := bytes.Index(data, sig)
+	if idx < 0 {
+		return nil, fmt.Errorf("未能在临时写入器的输出中找到中央目录记录")
+	}
+	if idx+46 > len(data) {
+		return nil, fmt.Errorf("临时写入器输出的中央目录记录被截断")
+	}
+	nameLen := int(binary.LittleEndian.Uint16(data[idx+28:]))
+	extraLen := int(binary.LittleEndian.Uint16(data[idx+30:]))
+	commentLen := int(binary.LittleEndian.Uint16(data[idx+32:]))
+	recLen := 46 + nameLen + extraLen + commentLen
+	if idx+recLen > len(data) {
+		return nil, fmt.Errorf("临时写入器输出的中央目录记录长度超出范围")
+	}
+	return data[idx : idx+recLen], nil
+}
+
+// cdLocation记录了归档末尾EOCD (及可能存在的Zip64 EOCD) 里描述的中央
+// 目录位置，以及是否使用了Zip64格式——后者决定patchEOCDCounts该去修正
+// 哪一组字段。
+type cdLocation struct {
+	cdOffset    int64
+	isZip64     bool
+	zip64RelOff int64 // zip64 EOCD记录相对cdOffset的偏移量，仅isZip64时有效
+}
+
+// locateCentralDirectory在destFile末尾查找经典EOCD（本工具从不设置归档
+// 注释，因此EOCD必定是文件最后22字节），在必要时再回溯解析Zip64 EOCD
+// 定位记录与Zip64 EOCD记录本身，得到中央目录的起始偏移量。
+func locateCentralDirectory(f *os.File, size int64) (cdLocation, error) {
+	if size < 22 {
+		return cdLocation{}, fmt.Errorf("文件过小，不是一个合法的zip归档")
+	}
+	eocd := make([]byte, 22)
+	if _, err := f.ReadAt(eocd, size-22); err != nil {
+		return cdLocation{}, fmt.Errorf("无法读取EOCD: %w", err)
+	}
+	if binary.LittleEndian.Uint32(eocd) != zipSigEOCD {
+		return cdLocation{}, fmt.Errorf("未能在文件末尾找到EOCD签名（归档使用了本工具从不写入的注释字段？）")
+	}
+
+	cdOffset32 := binary.LittleEndian.Uint32(eocd[16:])
+	totalEntries16 := binary.LittleEndian.Uint16(eocd[10:])
+	cdSize32 := binary.LittleEndian.Uint32(eocd[12:])
+
+	if cdOffset32 != 0xFFFFFFFF && totalEntries16 != 0xFFFF && cdSize32 != 0xFFFFFFFF {
+		return cdLocation{cdOffset: int64(cdOffset32)}, nil
+	}
+
+	if size < 22+20 {
+		return cdLocation{}, fmt.Errorf("声称使用Zip64但文件过小，不含Zip64 EOCD定位记录")
+	}
+	locRec := make([]byte, 20)
+	if _, err := f.ReadAt(locRec, size-22-20); err != nil {
+		return cdLocation{}, fmt.Errorf("无法读取Zip64 EOCD定位记录: %w", err)
+	}
+	if binary.LittleEndian.Uint32(locRec) != zipSigZip64EOCDLoc {
+		return cdLocation{}, fmt.Errorf("未能找到Zip64 EOCD定位记录")
+	}
+	zip64Off := int64(binary.LittleEndian.Uint64(locRec[8:]))
+
+	z64 := make([]byte, 56)
+	if _, err := f.ReadAt(z64, zip64Off); err != nil {
+		return cdLocation{}, fmt.Errorf("无法读取Zip64 EOCD记录: %w", err)
+	}
+	if binary.LittleEndian.Uint32(z64) != zipSigZip64EOCD {
+		return cdLocation{}, fmt.Errorf("Zip64 EOCD定位记录指向的偏移量处未找到Zip64 EOCD签名")
+	}
+	cdOffset64 := int64(binary.LittleEndian.Uint64(z64[48:]))
+
+	return cdLocation{cdOffset: cdOffset64, isZip64: true, zip64RelOff: zip64Off - cdOffset64}, nil
+}
+
+// patchEOCDCounts就地修正tail（即destFile中从cdOffset到文件末尾的字节，
+// 也就是本次会话写出的中央目录与EOCD）里的条目数与中央目录大小字段，
+// 加上addedEntries个回放条目及addedBytes字节，使其反映插入旧条目记录
+// 后的真实总量；中央目录起始偏移量不变，因此不需要修正任何offset字段。
+func patchEOCDCounts(tail []byte, loc cdLocation, addedEntries, addedBytes int) error {
+	if loc.isZip64 {
+		off := int(loc.zip64RelOff)
+		if off < 0 || off+56 > len(tail) {
+			return fmt.Errorf("Zip64 EOCD记录超出范围")
+		}
+		entriesDisk := binary.LittleEndian.Uint64(tail[off+24:]) + uint64(addedEntries)
+		entriesAll := binary.LittleEndian.Uint64(tail[off+32:]) + uint64(addedEntries)
+		cdSize := binary.LittleEndian.Uint64(tail[off+40:]) + uint64(addedBytes)
+		binary.LittleEndian.PutUint64(tail[off+24:], entriesDisk)
+		binary.LittleEndian.PutUint64(tail[off+32:], entriesAll)
+		binary.LittleEndian.PutUint64(tail[off+40:], cdSize)
+	}
+
+	eocdOff := len(tail) - 22
+	if eocdOff < 0 || binary.LittleEndian.Uint32(tail[eocdOff:]) != zipSigEOCD {
+		return fmt.Errorf("tail末尾不是EOCD记录")
+	}
+	entries16 := binary.LittleEndian.Uint16(tail[eocdOff+10:])
+	cdSize32 := binary.LittleEndian.Uint32(tail[eocdOff+12:])
+	if entries16 != 0xFFFF {
+		newEntries := int(entries16) + addedEntries
+		if newEntries > 0xFFFE && !loc.isZip64 {
+			return fmt.Errorf("回放续传前条目后总条目数超出非Zip64 zip格式上限，且原归档未使用Zip64，无法安全修正")
+		}
+		if newEntries <= 0xFFFE {
+			binary.LittleEndian.PutUint16(tail[eocdOff+8:], uint16(newEntries))
+			binary.LittleEndian.PutUint16(tail[eocdOff+10:], uint16(newEntries))
+		}
+	}
+	if cdSize32 != 0xFFFFFFFF {
+		newSize := int64(cdSize32) + int64(addedBytes)
+		if newSize > 0xFFFFFFFE && !loc.isZip64 {
+			return fmt.Errorf("回放续传前条目后中央目录大小超出非Zip64 zip格式上限，且原归档未使用Zip64，无法安全修正")
+		}
+		if newSize <= 0xFFFFFFFE {
+			binary.LittleEndian.PutUint32(tail[eocdOff+12:], uint32(newSize))
+		}
+	}
+	return nil
+}
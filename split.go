@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 常用大小单位，十进制与二进制各保留一套，解析-split-size时使用。
+const (
+	unitKB = 1000
+	unitMB = 1000 * unitKB
+	unitGB = 1000 * unitMB
+	unitTB = 1000 * unitGB
+
+	unitKiB = 1024
+	unitMiB = 1024 * unitKiB
+	unitGiB = 1024 * unitMiB
+	unitTiB = 1024 * unitGiB
+)
+
+// parseSplitSize 解析 -split-size 参数，支持带单位后缀（如100MB、5GiB、5TiB）
+// 的写法，也接受纯字节数；返回0表示不分卷。
+func parseSplitSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"TiB", unitTiB}, {"GiB", unitGiB}, {"MiB", unitMiB}, {"KiB", unitKiB},
+		{"TB", unitTB}, {"GB", unitGB}, {"MB", unitMB}, {"KB", unitKB}, {"B", 1},
+	}
+	upper := strings.ToUpper(s)
+	for _, u := range units {
+		if strings.HasSuffix(upper, strings.ToUpper(u.suffix)) {
+			numPart := s[:len(s)-len(u.suffix)]
+			n, err := strconv.ParseFloat(strings.TrimSpace(numPart), 64)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("无效的 -split-size 取值 %q", s)
+			}
+			return int64(n * float64(u.mul)), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("无效的 -split-size 取值 %q，可使用如 5GiB、100MB 或纯字节数", s)
+	}
+	return n, nil
+}
+
+// splitVolumeName 返回分卷归档中第n卷（从1开始）在磁盘上的临时文件路径，
+// 命名约定为去掉destFile扩展名后追加.zNN，如 backup.zip -> backup.z01、
+// backup.z02。对zip格式而言这只是写入过程中的临时名：Close时末卷会被
+// 重命名为destFile本身（即backup.zip），这是split-zip的标准约定——
+// 归档工具按.z01、.z02...、.zip的顺序查找各卷。
+func splitVolumeName(destFile string, n int) string {
+	ext := filepath.Ext(destFile)
+	base := strings.TrimSuffix(destFile, ext)
+	return fmt.Sprintf("%s.z%02d", base, n)
+}
+
+// VolumeDigest 记录某一个分卷文件的SHA256摘要，供写入.volumes.sha256边车文件。
+type VolumeDigest struct {
+	Name   string
+	SHA256 string
+}
+
+// SplitWriter 插在BufferedWriter与底层磁盘文件之间，达到-split-size设定的
+// 大小后自动切换到下一卷(dest.z01、dest.z02、...)，使单个归档可以分散到
+// 多盘磁带或可移动介质上。
+//
+// 对spanZip为true的调用方（即-format=zip）而言，SplitWriter会产出一份
+// 真正符合PKZIP分卷约定、可被unzip/7z直接读取的跨卷归档：调用方需要在
+// zip.Writer.Close()写出中央目录前调用一次ForceRotate，使中央目录与EOCD
+// 完整落在独立的一卷里；Close时该卷会被重命名为destFile本身（如
+// backup.zip），其余各卷保持dest.z01、dest.z02...的命名，并且会回写每条
+// 中央目录记录及EOCD/Zip64 EOCD中的磁盘号字段，使其准确反映条目实际所在
+// 的卷——archive/zip本身并不知道自己被分卷，写出时这些字段永远是0。
+type SplitWriter struct {
+	destFile     string
+	limit        int64
+	spanZip      bool
+	volIndex     int
+	volWritten   int64
+	totalWritten int64
+	volStarts    []int64 // 第i卷(0-based)在连续字节流中的起始偏移量
+	cur          *os.File
+	volHasher    hash.Hash
+	volSums      []VolumeDigest
+}
+
+// NewSplitWriter 创建一个SplitWriter并打开第一卷。spanZip为true时，Close
+// 会额外重命名末卷并修正跨卷磁盘号字段，使结果是一份标准的split-zip。
+func NewSplitWriter(destFile string, limit int64, spanZip bool) (*SplitWriter, error) {
+	sw := &SplitWriter{destFile: destFile, limit: limit, spanZip: spanZip}
+	if err := sw.rotate(); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (sw *SplitWriter) rotate() error {
+	if sw.cur != nil {
+		if err := sw.finishVolume(); err != nil {
+			return err
+		}
+	}
+	sw.volStarts = append(sw.volStarts, sw.totalWritten)
+	sw.volIndex++
+	name := splitVolumeName(sw.destFile, sw.volIndex)
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("无法创建分卷文件 %s: %w", name, err)
+	}
+	sw.cur = f
+	sw.volWritten = 0
+	sw.volHasher = sha256.New()
+	log.Printf("分卷: 开始写入 %s", name)
+	return nil
+}
+
+// ForceRotate无条件切换到下一卷，不等当前卷写满。spanZip模式下由调用方
+// 在写入zip中央目录之前调用一次，确保中央目录与EOCD完整落在末卷的起始
+// 处，这样修正磁盘号时无需处理中央目录跨卷的情形。
+func (sw *SplitWriter) ForceRotate() error {
+	return sw.rotate()
+}
+
+func (sw *SplitWriter) finishVolume() error {
+	name := sw.cur.Name()
+	if err := sw.cur.Close(); err != nil {
+		return fmt.Errorf("无法关闭分卷文件 %s: %w", name, err)
+	}
+	sw.volSums = append(sw.volSums, VolumeDigest{
+		Name:   filepath.Base(name),
+		SHA256: hex.EncodeToString(sw.volHasher.Sum(nil)),
+	})
+	return nil
+}
+
+func (sw *SplitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if sw.volWritten >= sw.limit {
+			if err := sw.rotate(); err != nil {
+				return written, err
+			}
+		}
+
+		chunk := p
+		if remaining := sw.limit - sw.volWritten; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		n, err := sw.cur.Write(chunk)
+		if n > 0 {
+			sw.volHasher.Write(chunk[:n])
+			sw.volWritten += int64(n)
+			sw.totalWritten += int64(n)
+			written += n
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close 关闭当前分卷文件，spanZip模式下重命名并修正末卷的跨卷磁盘号
+// 字段，返回每一卷各自的SHA256摘要。
+func (sw *SplitWriter) Close() ([]VolumeDigest, error) {
+	if err := sw.finishVolume(); err != nil {
+		return nil, err
+	}
+	if sw.spanZip {
+		if err := sw.finalizeZipSpan(); err != nil {
+			return nil, err
+		}
+	}
+	return sw.volSums, nil
+}
+
+// finalizeZipSpan把末卷（由调用方通过ForceRotate预留、只包含中央目录与
+// EOCD）重命名为destFile本身，并回写其中每条中央目录记录、以及EOCD/
+// Zip64 EOCD（及其定位记录）里的磁盘号字段，使结果可以被unzip/7z直接
+// 按.z01、.z02...、.zip的顺序读取，无需先手动拼接成单一文件。
+func (sw *SplitWriter) finalizeZipSpan() error {
+	oldPath := splitVolumeName(sw.destFile, sw.volIndex)
+	if err := os.Rename(oldPath, sw.destFile); err != nil {
+		return fmt.Errorf("无法将末卷 %s 重命名为 %s: %w", oldPath, sw.destFile, err)
+	}
+
+	data, err := os.ReadFile(sw.destFile)
+	if err != nil {
+		return fmt.Errorf("无法读取末卷 %s 以修正跨卷磁盘号: %w", sw.destFile, err)
+	}
+	if err := rewriteSpanDiskFields(data, sw.volStarts); err != nil {
+		return fmt.Errorf("无法修正跨卷ZIP的磁盘号字段: %w", err)
+	}
+	if err := os.WriteFile(sw.destFile, data, 0644); err != nil {
+		return fmt.Errorf("无法写回修正后的末卷 %s: %w", sw.destFile, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if n := len(sw.volSums); n > 0 {
+		sw.volSums[n-1] = VolumeDigest{Name: filepath.Base(sw.destFile), SHA256: hex.EncodeToString(sum[:])}
+	}
+	log.Printf("分卷: 末卷已重命名为 %s 并写入跨卷磁盘号，unzip/7z 可直接读取而无需手动拼接各卷", sw.destFile)
+	return nil
+}
+
+// ZIP中央目录/EOCD相关结构的签名，见PKWARE APPNOTE.TXT 4.3节。
+const (
+	zipSigCentralDir   = 0x02014b50
+	zipSigEOCD         = 0x06054b50
+	zipSigZip64EOCD    = 0x06064b50
+	zipSigZip64EOCDLoc = 0x07064b50
+)
+
+// rewriteSpanDiskFields在内存中的归档尾部（中央目录起始直到EOCD结尾，
+// 即destFile的完整内容——调用方已确保中央目录整体落在末卷里）原地修正
+// 每条中央目录记录的"磁盘号"字段，以及EOCD/Zip64 EOCD/Zip64 EOCD定位
+// 记录里涉及磁盘的字段。volStarts是每一卷在连续字节流中的起始偏移量，
+// 按卷号升序排列。
+func rewriteSpanDiskFields(data []byte, volStarts []int64) error {
+	if len(volStarts) == 0 {
+		return fmt.Errorf("缺少分卷起始偏移量信息")
+	}
+	finalVol := len(volStarts) - 1
+
+	off := 0
+	for off+4 <= len(data) && binary.LittleEndian.Uint32(data[off:]) == zipSigCentralDir {
+		if off+46 > len(data) {
+			return fmt.Errorf("中央目录记录在偏移量 %d 处被截断", off)
+		}
+		compSize32 := binary.LittleEndian.Uint32(data[off+20:])
+		uncompSize32 := binary.LittleEndian.Uint32(data[off+24:])
+		nameLen := int(binary.LittleEndian.Uint16(data[off+28:]))
+		extraLen := int(binary.LittleEndian.Uint16(data[off+30:]))
+		commentLen := int(binary.LittleEndian.Uint16(data[off+32:]))
+		localOffset32 := binary.LittleEndian.Uint32(data[off+42:])
+
+		extraStart := off + 46 + nameLen
+		extraEnd := extraStart + extraLen
+		if extraEnd > len(data) {
+			return fmt.Errorf("中央目录记录在偏移量 %d 处的extra字段被截断", off)
+		}
+
+		localOffset := int64(localOffset32)
+		if localOffset32 == 0xFFFFFFFF {
+			if lo, ok := zip64LocalOffsetFromExtra(data[extraStart:extraEnd], uncompSize32 == 0xFFFFFFFF, compSize32 == 0xFFFFFFFF); ok {
+				localOffset = lo
+			}
+		}
+
+		vol := volumeForOffset(volStarts, localOffset)
+		if vol <= 0xFFFE {
+			binary.LittleEndian.PutUint16(data[off+34:], uint16(vol))
+		}
+
+		off = extraEnd + commentLen
+	}
+
+	if off+4 <= len(data) && binary.LittleEndian.Uint32(data[off:]) == zipSigZip64EOCD {
+		if off+24 > len(data) {
+			return fmt.Errorf("Zip64 EOCD记录被截断")
+		}
+		size := binary.LittleEndian.Uint64(data[off+4:])
+		recEnd := off + 12 + int(size)
+		if recEnd > len(data) {
+			return fmt.Errorf("Zip64 EOCD记录声明的长度超出文件范围")
+		}
+		binary.LittleEndian.PutUint32(data[off+16:], uint32(finalVol)) // number of this disk
+		binary.LittleEndian.PutUint32(data[off+20:], uint32(finalVol)) // disk where central directory starts
+		off = recEnd
+	}
+
+	if off+4 <= len(data) && binary.LittleEndian.Uint32(data[off:]) == zipSigZip64EOCDLoc {
+		if off+20 > len(data) {
+			return fmt.Errorf("Zip64 EOCD定位记录被截断")
+		}
+		binary.LittleEndian.PutUint32(data[off+4:], uint32(finalVol))        // disk with the zip64 EOCD
+		binary.LittleEndian.PutUint32(data[off+16:], uint32(len(volStarts))) // total number of disks
+		off += 20
+	}
+
+	if off+4 <= len(data) && binary.LittleEndian.Uint32(data[off:]) == zipSigEOCD {
+		if off+22 > len(data) {
+			return fmt.Errorf("EOCD记录被截断")
+		}
+		diskVal := uint16(finalVol)
+		if finalVol > 0xFFFF {
+			diskVal = 0xFFFF // 实际磁盘数由Zip64 EOCD定位记录中的总磁盘数字段表达
+		}
+		binary.LittleEndian.PutUint16(data[off+4:], diskVal) // number of this disk
+		binary.LittleEndian.PutUint16(data[off+6:], diskVal) // disk where central directory starts
+	}
+
+	return nil
+}
+
+// zip64LocalOffsetFromExtra在一条中央目录记录的extra字段里查找id=0x0001
+// 的Zip64扩展信息子字段，按规范各8字节子字段只在对应的32位字段取值为
+// 0xFFFFFFFF时才会出现，且严格按原始大小、压缩大小、本地文件头偏移量的
+// 顺序排列，因此需要知道前两个字段是否存在才能定位偏移量子字段。
+func zip64LocalOffsetFromExtra(extra []byte, uncompNeeds, compNeeds bool) (int64, bool) {
+	p := 0
+	for p+4 <= len(extra) {
+		id := binary.LittleEndian.Uint16(extra[p:])
+		size := int(binary.LittleEndian.Uint16(extra[p+2:]))
+		if p+4+size > len(extra) {
+			return 0, false
+		}
+		body := extra[p+4 : p+4+size]
+		if id == 0x0001 {
+			q := 0
+			if uncompNeeds {
+				q += 8
+			}
+			if compNeeds {
+				q += 8
+			}
+			if q+8 > len(body) {
+				return 0, false
+			}
+			return int64(binary.LittleEndian.Uint64(body[q:])), true
+		}
+		p += 4 + size
+	}
+	return 0, false
+}
+
+// volumeForOffset返回off所属的卷号(0-based)：即满足volStarts[i] <= off的
+// 最大i，volStarts按升序排列。
+func volumeForOffset(volStarts []int64, off int64) int {
+	vol := 0
+	for i, start := range volStarts {
+		if start <= off {
+			vol = i
+		} else {
+			break
+		}
+	}
+	return vol
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// verifyResult 是单个归档条目的校验结果，由worker协程产出后交给
+// 主协程汇总统计，结构上与pipelineResult按index重排的思路类似，
+// 但verify不需要保持顺序，只需要按zipPath去重统计。
+type verifyResult struct {
+	zipPath string
+	hashes  map[string]string
+	err     error
+}
+
+// runVerify 实现 `ltfs-zip-archiver verify dest.zip` 子命令：用archive/zip
+// 的Reader重新打开归档，把每个条目都通过AsyncHashWriter重新计算一遍哈希，
+// 与断点清单中记录的per-entry哈希比对，报告不一致、缺失与多余的条目，
+// 让本工具具备只写之外的可回读校验能力。
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	jobs := fs.Int("j", 1, "并行校验使用的worker数量")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		log.Fatalf("用法: %s verify <归档文件>", os.Args[0])
+	}
+	destFile := fs.Arg(0)
+
+	if _, err := os.Stat(splitVolumeName(destFile, 1)); err == nil {
+		log.Fatalf("错误: %s 是一个跨卷归档（存在 %s），verify 子命令暂不支持校验分卷归档。", destFile, splitVolumeName(destFile, 1))
+	}
+
+	f, err := os.Open(destFile)
+	if err != nil {
+		log.Fatalf("错误: 无法打开归档文件 %s: %v", destFile, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("错误: 无法获取归档文件信息: %v", err)
+	}
+
+	// 基于ReaderAt的zip.NewReader允许多个worker并发调用各自File.Open()
+	// 而互不干扰，因此-j可以直接复用给校验阶段。
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		log.Fatalf("错误: 无法解析归档文件 %s: %v", destFile, err)
+	}
+
+	manifestEntries, merr := loadManifest(manifestPath(destFile))
+	hasManifest := merr == nil
+	if !hasManifest {
+		log.Printf("提示: 未找到断点清单 %s，将仅校验归档内CRC32，不核对哈希值与缺失/多余条目: %v", manifestPath(destFile), merr)
+	}
+
+	manifestZipPaths := make(map[string]bool, len(manifestEntries))
+	wantHashes := make(map[string]map[string]string, len(manifestEntries))
+	for _, e := range manifestEntries {
+		manifestZipPaths[e.ZipPath] = true
+		if len(e.Hashes) > 0 {
+			wantHashes[e.ZipPath] = e.Hashes
+		}
+	}
+
+	numWorkers := *jobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	fileCh := make(chan *zip.File)
+	resultCh := make(chan verifyResult, numWorkers)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for zf := range fileCh {
+				resultCh <- verifyEntry(zf, wantHashes[zf.Name])
+			}
+		}()
+	}
+
+	go func() {
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			fileCh <- zf
+		}
+		close(fileCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	seen := make(map[string]bool, len(zr.File))
+	mismatches := 0
+	extra := 0
+	for res := range resultCh {
+		seen[res.zipPath] = true
+
+		if res.err != nil {
+			log.Printf("不一致: %s 读取/校验失败: %v", res.zipPath, res.err)
+			mismatches++
+			continue
+		}
+
+		if hasManifest && !manifestZipPaths[res.zipPath] {
+			log.Printf("多余: %s 存在于归档中但未记录在断点清单内", res.zipPath)
+			extra++
+		}
+
+		for algo, sum := range wantHashes[res.zipPath] {
+			if res.hashes[algo] != sum {
+				log.Printf("不一致: %s 的%s校验和不匹配（清单: %s，实际: %s）", res.zipPath, algo, sum, res.hashes[algo])
+				mismatches++
+			}
+		}
+	}
+
+	missing := 0
+	if hasManifest {
+		for zipPath := range manifestZipPaths {
+			if !seen[zipPath] {
+				log.Printf("缺失: 清单中的 %s 未出现在归档中", zipPath)
+				missing++
+			}
+		}
+	}
+
+	if mismatches == 0 && missing == 0 && extra == 0 {
+		log.Printf("校验完成: 共 %d 个条目，全部一致。", len(seen))
+		return
+	}
+	log.Printf("校验完成: 发现 %d 处不一致，%d 个缺失条目，%d 个多余条目。", mismatches, missing, extra)
+	os.Exit(1)
+}
+
+// verifyEntry 重新读取单个归档条目：want非空时按其中列出的算法重新计算
+// 哈希以便比对，否则只依赖archive/zip在读完内容后自动做的CRC32校验
+// （CRC不匹配时io.Copy会返回zip.ErrChecksum）。
+func verifyEntry(zf *zip.File, want map[string]string) verifyResult {
+	res := verifyResult{zipPath: zf.Name}
+
+	rc, err := zf.Open()
+	if err != nil {
+		res.err = fmt.Errorf("无法打开条目: %w", err)
+		return res
+	}
+	defer rc.Close()
+
+	if len(want) == 0 {
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			res.err = fmt.Errorf("CRC32校验失败: %w", err)
+		}
+		return res
+	}
+
+	algos := make([]string, 0, len(want))
+	for algo := range want {
+		algos = append(algos, algo)
+	}
+
+	hw, herr := NewAsyncHashWriter(io.Discard, algos)
+	if herr != nil {
+		res.err = herr
+		return res
+	}
+	if _, err := io.Copy(hw, rc); err != nil {
+		hw.Close()
+		res.err = fmt.Errorf("CRC32校验失败: %w", err)
+		return res
+	}
+	res.hashes = hw.Sums()
+	return res
+}